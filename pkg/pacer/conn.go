@@ -0,0 +1,118 @@
+package pacer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// connTimeoutError is returned by ConnPacer's Read and Write when a
+// pending pace-sleep would have run past the configured deadline. It
+// implements net.Error so callers that type-assert for Timeout() see
+// the same shape of error a real deadline-exceeded conn would give them.
+type connTimeoutError struct{}
+
+func (connTimeoutError) Error() string   { return "pacer: i/o timeout" }
+func (connTimeoutError) Timeout() bool   { return true }
+func (connTimeoutError) Temporary() bool { return true }
+
+// ConnPacer wraps a net.Conn with independently configurable read and
+// write byte-per-second limits. It satisfies net.Conn itself, so it can
+// be used anywhere a net.Conn is expected, forwarding LocalAddr,
+// RemoteAddr, Close, and friends to the underlying connection.
+type ConnPacer struct {
+	net.Conn
+	rp *ReaderPacer
+	wp *WriterPacer
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewConnPacer wraps conn, limiting reads to readBytesPerSecond and
+// writes to writeBytesPerSecond.
+func NewConnPacer(conn net.Conn, readBytesPerSecond, writeBytesPerSecond int) *ConnPacer {
+	return &ConnPacer{
+		Conn: conn,
+		rp:   NewReaderPacer(conn, readBytesPerSecond),
+		wp:   NewWriterPacer(conn, writeBytesPerSecond),
+	}
+}
+
+// SetReadLimit changes the read rate and returns the previous value.
+func (c *ConnPacer) SetReadLimit(bytesPerSecond int) (old int) {
+	return c.rp.SetLimit(bytesPerSecond)
+}
+
+// SetWriteLimit changes the write rate and returns the previous value.
+func (c *ConnPacer) SetWriteLimit(bytesPerSecond int) (old int) {
+	return c.wp.SetLimit(bytesPerSecond)
+}
+
+// deadlineContext returns a context that is done when dl arrives, or
+// context.Background if dl is zero.
+func deadlineContext(dl time.Time) (context.Context, context.CancelFunc) {
+	if dl.IsZero() {
+		return context.Background(), func() {}
+	}
+	return context.WithDeadline(context.Background(), dl)
+}
+
+func (c *ConnPacer) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	dl := c.readDeadline
+	c.mu.Unlock()
+	ctx, cancel := deadlineContext(dl)
+	defer cancel()
+	c.rp.setContext(ctx)
+	cc, err := c.rp.Read(b)
+	if err == context.DeadlineExceeded {
+		return cc, connTimeoutError{}
+	}
+	return cc, err
+}
+
+func (c *ConnPacer) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	dl := c.writeDeadline
+	c.mu.Unlock()
+	ctx, cancel := deadlineContext(dl)
+	defer cancel()
+	c.wp.setContext(ctx)
+	cc, err := c.wp.Write(b)
+	if err == context.DeadlineExceeded {
+		return cc, connTimeoutError{}
+	}
+	return cc, err
+}
+
+// SetReadDeadline forwards to the underlying conn and, in addition,
+// caps how long a pace-sleep on Read may run: a pending wait that would
+// cross t returns a timeout error instead of sleeping past it.
+func (c *ConnPacer) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline forwards to the underlying conn and, in addition,
+// caps how long a pace-sleep on Write may run: a pending wait that
+// would cross t returns a timeout error instead of sleeping past it.
+func (c *ConnPacer) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (c *ConnPacer) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
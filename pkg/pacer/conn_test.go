@@ -0,0 +1,35 @@
+package pacer
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestConnPacerReadDeadline verifies that a pace-sleep on Read that
+// would run past the configured read deadline returns a timeout error
+// instead, rather than sleeping past the deadline.
+func TestConnPacerReadDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	cp := NewConnPacer(c1, 100, 100)
+	go c2.Write(make([]byte, 1000))
+
+	cp.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	n, err := cp.Read(make([]byte, 1000))
+	elapsed := time.Since(start)
+
+	if n != 1000 {
+		t.Fatalf("read %d bytes, want 1000", n)
+	}
+	ne, ok := err.(net.Error)
+	if !ok || !ne.Timeout() {
+		t.Fatalf("err = %v, want a net.Error with Timeout() true", err)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("read took %v, pacer did not respect read deadline", elapsed)
+	}
+}
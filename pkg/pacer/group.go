@@ -0,0 +1,43 @@
+package pacer
+
+import (
+	"io"
+)
+
+// Group is a shared rate-limit budget that several ReaderPacers and
+// WriterPacers can draw from at once, so that N concurrent transfers
+// together stay under one aggregate bytes-per-second cap rather than
+// each getting the full rate independently:
+//
+//	g := pacer.NewGroup(10 * 1 << 20)
+//	r1 := g.NewReader(src1)
+//	w2 := g.NewWriter(dst2)
+//
+// All pacers created from a Group share the same token bucket,
+// protected by a mutex, so reads and writes across the group are paced
+// fairly against the group's single budget. SetLimit and SetBurst also
+// act on that shared budget, so calling either on r1 retunes w2 too.
+// Cancellation and blocking mode are not shared, though: WithContext
+// and SetBlocking affect only the wrapper they're called on, so one
+// connection's timeout or fail-fast setting can't cross-cancel or
+// cross-block an unrelated sibling drawing from the same group.
+type Group struct {
+	b *bucket
+}
+
+// NewGroup creates a Group with an aggregate budget of bytesPerSecond.
+func NewGroup(bytesPerSecond int) *Group {
+	return &Group{b: newBucket(bytesPerSecond)}
+}
+
+// NewReader wraps r with a ReaderPacer that draws from the group's
+// shared budget.
+func (g *Group) NewReader(r io.Reader) *ReaderPacer {
+	return &ReaderPacer{Pacer: Pacer{b: g.b}, reader: r}
+}
+
+// NewWriter wraps w with a WriterPacer that draws from the group's
+// shared budget.
+func (g *Group) NewWriter(w io.Writer) *WriterPacer {
+	return &WriterPacer{Pacer: Pacer{b: g.b}, writer: w}
+}
@@ -0,0 +1,113 @@
+package pacer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGroupConcurrentContention guards against a shared bucket's virtual
+// clock drifting into the future when several waiters block on it at
+// once. It forces a contended round (more bytes requested at once than
+// the burst allows, across several writers), then checks that a later,
+// uncontended write is paced against real elapsed time rather than
+// against the sum of every earlier waiter's own wait.
+func TestGroupConcurrentContention(t *testing.T) {
+	const rate = 1000 // bytes/sec, also the default burst
+	const writers = 8
+	const chunk = 250 // 8*250 = 2000 > burst, so half the writers must wait
+
+	g := NewGroup(rate)
+	wps := make([]*WriterPacer, writers)
+	for i := range wps {
+		wps[i] = g.NewWriter(&bytes.Buffer{})
+	}
+
+	// Run several contended rounds back to back: each round has more
+	// bytes requested at once than the burst allows, so multiple
+	// writers block on the bucket concurrently. A drifting virtual
+	// clock compounds round over round. Only the first round gets the
+	// benefit of the initial burst; after that every byte has to be
+	// earned at rate bytes/sec.
+	const rounds = 3
+	total := rounds * writers * chunk
+	want := time.Duration(total-rate) * time.Second / rate
+	start := time.Now()
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		for _, wp := range wps {
+			wg.Add(1)
+			go func(wp *WriterPacer) {
+				defer wg.Done()
+				if _, err := wp.Write(make([]byte, chunk)); err != nil {
+					t.Errorf("write: %v", err)
+				}
+			}(wp)
+		}
+		wg.Wait()
+	}
+	contended := time.Since(start)
+	if contended > want+2*time.Second {
+		t.Fatalf("%d contended rounds took %v, want ~%v", rounds, contended, want)
+	}
+
+	// One more second's worth of budget, uncontended. If the earlier
+	// contention left the bucket's virtual clock ahead of real time,
+	// this compounds into a much longer wait instead of ~1s.
+	start = time.Now()
+	if _, err := wps[0].Write(make([]byte, rate)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("uncontended write after contention took %v, want ~1s", elapsed)
+	}
+}
+
+// TestGroupWithContextIsPerWrapper verifies that WithContext affects
+// only the wrapper it's called on, not sibling wrappers drawing from
+// the same Group's shared budget.
+// Canceling one connection's context must not cross-cancel an unrelated
+// concurrent transfer sharing the group.
+func TestGroupWithContextIsPerWrapper(t *testing.T) {
+	const rate = 50 // bytes/sec, also the default burst
+	const chunk = 100
+
+	g := NewGroup(rate)
+	var buf1, buf2 bytes.Buffer
+	w1 := g.NewWriter(&buf1)
+	w2 := g.NewWriter(&buf2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w1.WithContext(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var err1, err2 error
+	start := time.Now()
+	go func() {
+		defer wg.Done()
+		_, err1 = w1.Write(make([]byte, chunk))
+	}()
+	go func() {
+		defer wg.Done()
+		_, err2 = w2.Write(make([]byte, chunk))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if !errors.Is(err1, context.Canceled) {
+		t.Fatalf("w1 (canceled) error = %v, want context.Canceled", err1)
+	}
+	if err2 != nil {
+		t.Fatalf("w2 (not canceled) error = %v, want nil: canceling w1's context must not affect a sibling sharing the same group's budget", err2)
+	}
+	if elapsed < time.Second {
+		t.Fatalf("both writes returned in %v; w2 should have had to wait out its share of the shared budget", elapsed)
+	}
+}
@@ -0,0 +1,99 @@
+package pacer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSetLimitRetunesRate verifies that SetLimit changes the pacing rate
+// of a stream already in flight and reports the previous rate.
+func TestSetLimitRetunesRate(t *testing.T) {
+	wp := NewWriterPacer(&bytes.Buffer{}, 100)
+
+	if old := wp.SetLimit(1000); old != 100 {
+		t.Fatalf("SetLimit returned %d, want 100", old)
+	}
+
+	// At the new, faster rate, a write well beyond the old rate's burst
+	// should still complete quickly rather than pacing at the old rate.
+	start := time.Now()
+	if _, err := wp.Write(make([]byte, 1000)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("write took %v after SetLimit(1000), want ~1s", elapsed)
+	}
+}
+
+// TestSetBlockingRoundTrip verifies SetBlocking reports the previous
+// setting and that Pacers default to blocking.
+func TestSetBlockingRoundTrip(t *testing.T) {
+	wp := NewWriterPacer(&bytes.Buffer{}, 100)
+
+	if old := wp.SetBlocking(false); old != true {
+		t.Fatalf("SetBlocking(false) returned old=%v, want true (default is blocking)", old)
+	}
+	if old := wp.SetBlocking(true); old != false {
+		t.Fatalf("SetBlocking(true) returned old=%v, want false", old)
+	}
+}
+
+// TestNonBlockingShortWrite verifies that a non-blocking WriterPacer
+// writes only what the current token budget allows and returns the
+// short count alongside ErrLimit, rather than blocking.
+func TestNonBlockingShortWrite(t *testing.T) {
+	const rate = 1000 // bytes/sec, also the default burst
+
+	var buf bytes.Buffer
+	wp := NewWriterPacer(&buf, rate)
+	wp.SetBlocking(false)
+
+	start := time.Now()
+	n, err := wp.Write(make([]byte, 2*rate))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrLimit) {
+		t.Fatalf("err = %v, want ErrLimit", err)
+	}
+	if n != rate {
+		t.Fatalf("n = %d, want %d (exactly the burst available)", n, rate)
+	}
+	if buf.Len() != rate {
+		t.Fatalf("underlying writer got %d bytes, want %d", buf.Len(), rate)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("non-blocking write took %v, want immediate return", elapsed)
+	}
+}
+
+// TestNonBlockingNoTokensLeft verifies that a non-blocking Read/Write
+// with no tokens left returns (0, ErrLimit) instead of blocking.
+func TestNonBlockingNoTokensLeft(t *testing.T) {
+	const rate = 1000
+
+	var buf bytes.Buffer
+	wp := NewWriterPacer(&buf, rate)
+	wp.SetBlocking(false)
+
+	// Drain the burst.
+	if _, err := wp.Write(make([]byte, rate)); err != nil {
+		t.Fatalf("initial write: %v", err)
+	}
+
+	n, err := wp.Write(make([]byte, 10))
+	if n != 0 || !errors.Is(err, ErrLimit) {
+		t.Fatalf("Write() = %d, %v, want 0, ErrLimit", n, err)
+	}
+
+	rp := NewReaderPacer(bytes.NewReader(make([]byte, rate+10)), rate)
+	rp.SetBlocking(false)
+	if _, err := rp.Read(make([]byte, rate)); err != nil {
+		t.Fatalf("initial read: %v", err)
+	}
+	n, err = rp.Read(make([]byte, 10))
+	if n != 0 || !errors.Is(err, ErrLimit) {
+		t.Fatalf("Read() = %d, %v, want 0, ErrLimit", n, err)
+	}
+}
@@ -0,0 +1,141 @@
+package pacer
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Default sampling parameters used by monitor, chosen to smooth over
+// bursty reads/writes without lagging status reporting noticeably.
+const (
+	defaultSampleInterval = 100 * time.Millisecond
+	defaultWindowSize     = time.Second
+)
+
+// Status reports the live throughput of a ReaderPacer or WriterPacer, as
+// observed rather than as configured. It is returned by Pacer.Status.
+type Status struct {
+	Bytes      int64         // total bytes transferred so far
+	Duration   time.Duration // time since the first byte was transferred
+	SampleRate float64       // instantaneous rate over the last sample window, bytes/sec
+	AvgRate    float64       // exponential moving average rate, bytes/sec
+	PeakRate   float64       // highest SampleRate observed, bytes/sec
+	Progress   float64       // percentage of TransferSize transferred, 0 if no size is set
+	TimeRem    time.Duration // estimated time remaining, 0 if no size is set or AvgRate is 0
+}
+
+// monitor tracks the statistics behind Pacer.Status. It is safe for
+// concurrent use since Status is commonly polled from a goroutine other
+// than the one driving Read or Write.
+type monitor struct {
+	mu             sync.Mutex
+	sampleInterval time.Duration
+	windowSize     time.Duration
+	size           int64
+
+	start       time.Time
+	bytes       int64
+	sampleStart time.Time
+	sampleBytes int64
+	sampleRate  float64
+	avgRate     float64
+	peakRate    float64
+}
+
+func (m *monitor) record(cc int) {
+	if cc <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sampleInterval <= 0 {
+		m.sampleInterval = defaultSampleInterval
+	}
+	if m.windowSize <= 0 {
+		m.windowSize = defaultWindowSize
+	}
+	now := time.Now()
+	if m.start.IsZero() {
+		m.start = now
+		m.sampleStart = now
+	}
+	m.bytes += int64(cc)
+	m.sampleBytes += int64(cc)
+
+	elapsed := now.Sub(m.sampleStart)
+	if elapsed >= m.sampleInterval {
+		rate := float64(m.sampleBytes) / elapsed.Seconds()
+		m.sampleRate = rate
+		if rate > m.peakRate {
+			m.peakRate = rate
+		}
+		weight := 1 - math.Exp(-elapsed.Seconds()/m.windowSize.Seconds())
+		m.avgRate = weight*rate + (1-weight)*m.avgRate
+		m.sampleStart = now
+		m.sampleBytes = 0
+	}
+}
+
+func (m *monitor) status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{
+		Bytes:      m.bytes,
+		SampleRate: m.sampleRate,
+		AvgRate:    m.avgRate,
+		PeakRate:   m.peakRate,
+	}
+	if !m.start.IsZero() {
+		st.Duration = time.Since(m.start)
+	}
+	if m.size > 0 {
+		st.Progress = float64(m.bytes) / float64(m.size) * 100
+		if m.avgRate > 0 {
+			remaining := m.size - m.bytes
+			st.TimeRem = time.Duration(float64(remaining) / m.avgRate * float64(time.Second))
+		}
+	}
+	return st
+}
+
+func (m *monitor) setTransferSize(size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.size = size
+}
+
+func (m *monitor) setSampleInterval(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sampleInterval = d
+}
+
+func (m *monitor) setWindowSize(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windowSize = d
+}
+
+// Status returns a snapshot of the pacer's observed throughput.
+func (p *Pacer) Status() Status {
+	return p.mon.status()
+}
+
+// SetTransferSize tells the pacer the total number of bytes expected to
+// be transferred, enabling Progress and TimeRem in Status.
+func (p *Pacer) SetTransferSize(size int64) {
+	p.mon.setTransferSize(size)
+}
+
+// SetSampleInterval configures how often Status's instantaneous
+// SampleRate and the AvgRate EMA are recomputed. The default is 100ms.
+func (p *Pacer) SetSampleInterval(d time.Duration) {
+	p.mon.setSampleInterval(d)
+}
+
+// SetWindowSize configures the EMA window used to smooth AvgRate: a
+// larger window reacts to rate changes more slowly. The default is 1s.
+func (p *Pacer) SetWindowSize(d time.Duration) {
+	p.mon.setWindowSize(d)
+}
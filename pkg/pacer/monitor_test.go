@@ -0,0 +1,85 @@
+package pacer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestStatusZeroBeforeTransfer verifies Status reports its zero value
+// before any bytes have moved, rather than e.g. treating an unset start
+// time as "now".
+func TestStatusZeroBeforeTransfer(t *testing.T) {
+	wp := NewWriterPacer(&bytes.Buffer{}, 1000)
+	st := wp.Status()
+	want := Status{}
+	if st != want {
+		t.Fatalf("Status before any write = %+v, want %+v", st, want)
+	}
+}
+
+// TestStatusTracksBytesAndProgress verifies Bytes, Progress, and TimeRem
+// track a transfer of a known size through to completion.
+func TestStatusTracksBytesAndProgress(t *testing.T) {
+	const rate = 1000
+	const size = 3000
+
+	wp := NewWriterPacer(&bytes.Buffer{}, rate)
+	wp.SetSampleInterval(5 * time.Millisecond)
+	wp.SetTransferSize(size)
+
+	for i := 0; i < 3; i++ {
+		if _, err := wp.Write(make([]byte, 1000)); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+		if st := wp.Status(); st.Bytes != int64((i+1)*1000) {
+			t.Fatalf("after write %d, Bytes = %d, want %d", i, st.Bytes, (i+1)*1000)
+		}
+	}
+
+	st := wp.Status()
+	if st.Bytes != size {
+		t.Fatalf("Bytes = %d, want %d", st.Bytes, size)
+	}
+	if st.Progress != 100 {
+		t.Fatalf("Progress = %v, want 100", st.Progress)
+	}
+	if st.TimeRem != 0 {
+		t.Fatalf("TimeRem = %v, want 0 once the transfer is complete", st.TimeRem)
+	}
+	if st.Duration <= 0 {
+		t.Fatalf("Duration = %v, want > 0", st.Duration)
+	}
+}
+
+// TestStatusEMARate verifies the sample/EMA machinery produces a
+// SampleRate and AvgRate in the right ballpark for a steady-ish stream,
+// and that PeakRate never falls below the latest SampleRate.
+func TestStatusEMARate(t *testing.T) {
+	const rate = 1 << 20 // effectively unlimited for this test
+	wp := NewWriterPacer(&bytes.Buffer{}, rate)
+	wp.SetSampleInterval(10 * time.Millisecond)
+	wp.SetWindowSize(50 * time.Millisecond)
+
+	// ~20 bytes every 20ms is ~1000 B/s.
+	for i := 0; i < 20; i++ {
+		if _, err := wp.Write(make([]byte, 20)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	st := wp.Status()
+	if st.Bytes != 400 {
+		t.Fatalf("Bytes = %d, want 400", st.Bytes)
+	}
+	if st.SampleRate <= 0 {
+		t.Fatalf("SampleRate = %v, want > 0", st.SampleRate)
+	}
+	if st.AvgRate < 200 || st.AvgRate > 5000 {
+		t.Fatalf("AvgRate = %v, want roughly 1000 (wide band for scheduling jitter)", st.AvgRate)
+	}
+	if st.PeakRate < st.SampleRate {
+		t.Fatalf("PeakRate = %v, want >= latest SampleRate %v", st.PeakRate, st.SampleRate)
+	}
+}
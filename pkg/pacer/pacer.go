@@ -6,77 +6,392 @@
 // will allow.
 //
 // There are a million ways to do rate limiting but we just do the
-// well-known and simple virtual clock algorithm here.
+// well-known and simple token-bucket algorithm here.
 //
 // This is useful for testing.
 //
 package pacer
 
 import (
+	"context"
+	"errors"
 	"io"
+	"sync"
 	"time"
 )
 
-// Pacer xxx
-type Pacer struct {
+// ErrLimit is returned by Read or Write when the pacer is in
+// non-blocking mode (see SetBlocking) and the current token budget
+// can't satisfy the full request. The bytes actually transferred, if
+// any, are returned alongside it.
+var ErrLimit = errors.New("pacer: rate limit exceeded")
+
+// bucket is the token bucket behind one or more Pacers. It is factored
+// out of Pacer, rather than held inline, so that a Group can point
+// several ReaderPacers and WriterPacers at the same bucket and have
+// them draw from one shared rate/burst budget. It deliberately holds
+// only the budget itself (rate, burst, tokens) — per-wrapper behavior
+// like cancellation and blocking mode lives on Pacer instead, so that
+// configuring one wrapper from a Group can't change another's.
+type bucket struct {
+	mu             sync.Mutex
 	bytesPerSecond int
-	clock          time.Time
+	burst          int
+	tokens         float64
+	last           time.Time
+}
+
+func newBucket(bytesPerSecond int) *bucket {
+	return &bucket{bytesPerSecond: bytesPerSecond}
+}
+
+// initLocked establishes defaults on first use. Callers must hold mu.
+func (b *bucket) initLocked() {
+	if b.burst <= 0 {
+		b.burst = b.bytesPerSecond
+	}
+	if b.last.IsZero() {
+		b.last = time.Now()
+		b.tokens = float64(b.burst)
+	}
+}
+
+// setBurst configures the maximum number of bytes the bucket can
+// accumulate. Like the rate itself, burst is a property of the shared
+// budget: on a Pacer built from a Group, this affects every wrapper
+// drawing from that group.
+func (b *bucket) setBurst(burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.burst = burst
 }
 
-func (p *Pacer) pace(cc int) {
+func (b *bucket) burstSize() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.initLocked()
+	return b.burst
+}
+
+// setLimit changes the bucket's rate. Like burst, this is shared budget
+// state: on a Group it retunes every wrapper drawing from it.
+func (b *bucket) setLimit(bytesPerSecond int) (old int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.initLocked()
+	b.refillLocked()
+	old = b.bytesPerSecond
+	b.bytesPerSecond = bytesPerSecond
+	return old
+}
+
+// refillLocked credits the bucket with the tokens earned since the last
+// call, capped at the configured burst size. Callers must hold mu.
+func (b *bucket) refillLocked() {
 	now := time.Now()
-	if p.clock.IsZero() {
-		p.clock = now
+	elapsed := now.Sub(b.last)
+	b.last = now
+	b.tokens += elapsed.Seconds() * float64(b.bytesPerSecond)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
 	}
-	delay := time.Duration((int(time.Second) * cc) / p.bytesPerSecond)
-	p.clock = p.clock.Add(delay)
-	if p.clock.After(now) {
-		time.Sleep(p.clock.Sub(now))
+}
+
+// available reports how many bytes' worth of tokens are in the bucket
+// right now, without waiting for more to accrue.
+func (b *bucket) available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.initLocked()
+	b.refillLocked()
+	return int(b.tokens)
+}
+
+// consume spends n bytes' worth of tokens already known to be available,
+// without waiting.
+func (b *bucket) consume(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		b.tokens = 0
 	}
 }
 
+// wait blocks until n bytes' worth of tokens are available, or returns
+// ctx.Err() if ctx is done first. ctx is supplied by the caller rather
+// than stored on the bucket itself, since a bucket may be shared by
+// several independent wrappers (see Group) that each need their own
+// cancellation, not one that cross-cancels the others.
+//
+// A bucket may be shared by several waiters at once (see Group), so a
+// waiter can't assume the tokens it was short of are still short by the
+// time it wakes up: another waiter may have refilled or spent them in
+// the meantime. Each iteration re-refills against the real wall-clock
+// elapsed time and rechecks, rather than advancing the virtual clock by
+// its own computed delay, which would let concurrent waiters' delays
+// stack and drive the bucket's clock ahead of real time.
+func (b *bucket) wait(n int, ctx context.Context) error {
+	b.mu.Lock()
+	b.initLocked()
+	b.refillLocked()
+	for b.tokens < float64(n) {
+		shortfall := float64(n) - b.tokens
+		rate := b.bytesPerSecond
+		b.mu.Unlock()
+
+		delay := time.Duration(shortfall / float64(rate) * float64(time.Second))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		b.mu.Lock()
+		b.refillLocked()
+	}
+	b.tokens -= float64(n)
+	b.mu.Unlock()
+	return nil
+}
+
+// Pacer is the rate-limiting wrapper shared by ReaderPacer and
+// WriterPacer. It is embedded rather than used directly.
+//
+// Pacer holds two kinds of state: the token bucket (budget), which a
+// Group may share across several Pacers, and per-wrapper settings
+// (cancellation context, blocking mode), which always belong to this
+// Pacer alone even when its bucket is shared.
+type Pacer struct {
+	b   *bucket
+	mon monitor
+
+	mu          sync.Mutex
+	ctx         context.Context
+	nonBlocking bool
+}
+
+// SetBurst configures the maximum number of bytes the token bucket can
+// accumulate, i.e., how far a Read or Write may burst ahead of the
+// steady-state rate before it must wait. The default burst is one
+// second's worth of the rate the pacer was created with; SetLimit does
+// not change it. Burst is budget state: on a
+// Pacer built from a Group, this affects every wrapper sharing that
+// group's budget.
+func (p *Pacer) SetBurst(burst int) {
+	p.b.setBurst(burst)
+}
+
+// context returns the pacer's cancellation context, defaulting to
+// context.Background if none was set.
+func (p *Pacer) context() context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+func (p *Pacer) setContext(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctx = ctx
+}
+
+// WithContext attaches ctx to the pacer. A blocked Read or Write returns
+// ctx.Err() as soon as ctx is done rather than sleeping through its
+// cancellation. This is per-wrapper state: on a Pacer built from a
+// Group, it affects only this wrapper, not the sibling wrappers sharing
+// the group's budget.
+func (p *Pacer) WithContext(ctx context.Context) *Pacer {
+	p.setContext(ctx)
+	return p
+}
+
+// SetLimit changes the pacing rate to bytesPerSecond and returns the
+// previous rate. It may be called concurrently with Read or Write to
+// retune a stream in flight, e.g. in response to a congestion signal,
+// without tearing down the pacer. This is budget state: if the pacer
+// was built from a Group, this retunes the whole group's shared budget.
+func (p *Pacer) SetLimit(bytesPerSecond int) (old int) {
+	return p.b.setLimit(bytesPerSecond)
+}
+
+// SetBlocking toggles whether Read and Write block to enforce the rate
+// limit (the default) or return immediately with ErrLimit once the
+// token budget is exhausted. It returns the previous setting. This is
+// per-wrapper state: on a Pacer built from a Group, it affects only
+// this wrapper, not the sibling wrappers sharing the group's budget.
+func (p *Pacer) SetBlocking(block bool) (old bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old = !p.nonBlocking
+	p.nonBlocking = !block
+	return old
+}
+
+func (p *Pacer) isBlocking() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.nonBlocking
+}
+
 // ReaderPacer is an io.Reader with a rate limit
 type ReaderPacer struct {
 	Pacer
 	reader io.Reader
 }
 
-// WriterPacer is an io.Writer with a rate limit
-type WriterPacer struct {
-	Pacer
-	writer io.Writer
-}
-
-// NewReaderPacer wraps the writer and limits its writing to the
+// NewReaderPacer wraps the reader and limits its reading to the
 // rate in bytes-per-second indicated.
 func NewReaderPacer(r io.Reader, rate int) *ReaderPacer {
-	rp := &ReaderPacer{reader: r}
-	rp.bytesPerSecond = rate
+	return NewReaderPacerContext(context.Background(), r, rate)
+}
+
+// NewReaderPacerContext is like NewReaderPacer but ties the pacer to ctx
+// so a blocked Read returns ctx.Err() promptly when ctx is canceled.
+func NewReaderPacerContext(ctx context.Context, r io.Reader, rate int) *ReaderPacer {
+	rp := &ReaderPacer{Pacer: Pacer{b: newBucket(rate)}, reader: r}
+	rp.ctx = ctx
 	return rp
 }
 
+// WithContext attaches ctx to the pacer and returns the ReaderPacer so
+// it can be chained straight into an io.Reader, e.g.
+// pacer.NewReaderPacer(r, rate).WithContext(ctx).
+func (p *ReaderPacer) WithContext(ctx context.Context) *ReaderPacer {
+	p.setContext(ctx)
+	return p
+}
+
 func (p *ReaderPacer) Read(b []byte) (int, error) {
+	if !p.isBlocking() {
+		avail := p.b.available()
+		if avail <= 0 {
+			return 0, ErrLimit
+		}
+		limited := avail < len(b)
+		if limited {
+			b = b[:avail]
+		}
+		cc, err := p.reader.Read(b)
+		if cc > 0 {
+			p.mon.record(cc)
+			p.b.consume(cc)
+		}
+		if err != nil {
+			return cc, err
+		}
+		if limited {
+			return cc, ErrLimit
+		}
+		return cc, nil
+	}
+
 	cc, err := p.reader.Read(b)
 	if err != nil {
 		return cc, err
 	}
-	p.pace(cc)
+	p.mon.record(cc)
+	// The bucket never holds more than burst tokens, so a read larger
+	// than the burst is paid for in burst-sized pieces.
+	burst := p.b.burstSize()
+	ctx := p.context()
+	for rem := cc; rem > 0; {
+		n := rem
+		if n > burst {
+			n = burst
+		}
+		if werr := p.b.wait(n, ctx); werr != nil {
+			return cc, werr
+		}
+		rem -= n
+	}
 	return cc, nil
 }
 
+// WriterPacer is an io.Writer with a rate limit
+type WriterPacer struct {
+	Pacer
+	writer io.Writer
+}
+
 // NewWriterPacer wraps the writer and limits its writing to the
 // rate in bytes-per-second indicated.
 func NewWriterPacer(w io.Writer, rate int) *WriterPacer {
-	wp := &WriterPacer{writer: w}
-	wp.bytesPerSecond = rate
+	return NewWriterPacerContext(context.Background(), w, rate)
+}
+
+// NewWriterPacerContext is like NewWriterPacer but ties the pacer to ctx
+// so a blocked Write returns ctx.Err() promptly when ctx is canceled.
+func NewWriterPacerContext(ctx context.Context, w io.Writer, rate int) *WriterPacer {
+	wp := &WriterPacer{Pacer: Pacer{b: newBucket(rate)}, writer: w}
+	wp.ctx = ctx
 	return wp
 }
 
+// WithContext attaches ctx to the pacer and returns the WriterPacer so
+// it can be chained straight into an io.Writer, e.g.
+// pacer.NewWriterPacer(w, rate).WithContext(ctx).
+func (p *WriterPacer) WithContext(ctx context.Context) *WriterPacer {
+	p.setContext(ctx)
+	return p
+}
+
+// Write paces b to the configured rate. Buffers larger than the burst
+// size are split into burst-sized chunks so that a single large Write
+// is paced as it goes rather than handed to the underlying writer in
+// one shot and only throttled afterward.
+//
+// If the pacer is non-blocking (see SetBlocking), Write instead writes
+// only as many bytes as the current token budget allows and returns a
+// short count alongside ErrLimit.
 func (p *WriterPacer) Write(b []byte) (int, error) {
-	cc, err := p.writer.Write(b)
-	if err != nil {
-		return cc, err
+	if !p.isBlocking() {
+		avail := p.b.available()
+		if avail <= 0 {
+			return 0, ErrLimit
+		}
+		chunk := b
+		limited := avail < len(chunk)
+		if limited {
+			chunk = chunk[:avail]
+		}
+		cc, err := p.writer.Write(chunk)
+		if cc > 0 {
+			p.mon.record(cc)
+			p.b.consume(cc)
+		}
+		if err != nil {
+			return cc, err
+		}
+		if limited {
+			return cc, ErrLimit
+		}
+		return cc, nil
 	}
-	p.pace(cc)
-	return cc, nil
+
+	burst := p.b.burstSize()
+	ctx := p.context()
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		cc, err := p.writer.Write(chunk)
+		written += cc
+		if err != nil {
+			return written, err
+		}
+		p.mon.record(cc)
+		if werr := p.b.wait(cc, ctx); werr != nil {
+			return written, werr
+		}
+		b = b[cc:]
+	}
+	return written, nil
 }
@@ -0,0 +1,41 @@
+package pacer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestWithContextChains verifies that WithContext on ReaderPacer and
+// WriterPacer returns the concrete wrapper type, not the bare embedded
+// Pacer, so it can be chained straight into an io.Reader/io.Writer.
+func TestWithContextChains(t *testing.T) {
+	ctx := context.Background()
+	var _ io.Reader = NewReaderPacer(bytes.NewReader(nil), 1).WithContext(ctx)
+	var _ io.Writer = NewWriterPacer(&bytes.Buffer{}, 1).WithContext(ctx)
+}
+
+// TestWithContextCancel verifies that a Read blocked on pacing returns
+// ctx.Err() promptly once ctx is canceled, instead of sleeping through
+// the cancellation.
+func TestWithContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rp := NewReaderPacer(bytes.NewReader(make([]byte, 100)), 10).WithContext(ctx)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := rp.Read(make([]byte, 100))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("read error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read blocked for %v past cancellation, pacing did not respect ctx", elapsed)
+	}
+}